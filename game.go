@@ -0,0 +1,649 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Lerg/multiplayer-tag-server/obstacle"
+	"github.com/stojg/vector"
+)
+
+const (
+	mapWidth  = 1280.0
+	mapHeight = 720.0
+
+	// defaultTickMs is used when a /game/start request omits tick_ms or
+	// supplies a non-positive value.
+	defaultTickMs = 16
+
+	// mapsDir is the only directory /game/start's "map" field is allowed
+	// to load from; the client-supplied name is resolved inside it, so it
+	// cannot escape.
+	mapsDir = "maps"
+
+	turnSpeed = 0.1
+	maxSpeed  = 5.0
+	radius    = 50.0
+	cooldown  = 3 * 1000 * 1000 * 1000 // Nanoseconds
+)
+
+// Game is one independent tag match: its own players, tick loop and tag
+// state. Multiple Games can run concurrently in the same process, each
+// reachable over its own websocket endpoint.
+type Game struct {
+	Id              string
+	mu              sync.RWMutex
+	mode            GameMode
+	tickMs          int
+	width, height   float64
+	wrapEdges       bool
+	obstacles       []obstacle.Obstacle
+	players         map[int]*player
+	nextId          int
+	spectators      map[int]*spectator
+	nextSpectatorId int
+	sregister       chan *spectator
+	sunregister     chan *spectator
+	done            chan struct{}
+
+	tickTimes  *ringBuffer // simulation duration per tick, in nanoseconds
+	tagChanges *ringBuffer // one sample per tag change, for a rate estimate
+}
+
+// gameConfig bundles the tunables accepted by /game/start. A nil Mode or
+// a non-positive TickMs, Width or Height falls back to its default; a
+// false WrapEdges means solid walls.
+type gameConfig struct {
+	Mode      GameMode
+	TickMs    int
+	Width     float64
+	Height    float64
+	WrapEdges bool
+	Obstacles []obstacle.Obstacle
+}
+
+func newGame(id string, cfg gameConfig) *Game {
+	mode := cfg.Mode
+	if mode == nil {
+		mode = classicMode{}
+	}
+	tickMs := cfg.TickMs
+	if tickMs <= 0 {
+		tickMs = defaultTickMs
+	}
+	width := cfg.Width
+	if width <= 0 {
+		width = mapWidth
+	}
+	height := cfg.Height
+	if height <= 0 {
+		height = mapHeight
+	}
+	return &Game{
+		Id:          id,
+		mode:        mode,
+		tickMs:      tickMs,
+		width:       width,
+		height:      height,
+		wrapEdges:   cfg.WrapEdges,
+		obstacles:   cfg.Obstacles,
+		players:     make(map[int]*player),
+		spectators:  make(map[int]*spectator),
+		sregister:   make(chan *spectator),
+		sunregister: make(chan *spectator),
+		done:        make(chan struct{}),
+		tickTimes:   newRingBuffer(300),
+		tagChanges:  newRingBuffer(ringSize),
+	}
+}
+
+// run drives the game's tick loop until stop is called.
+func (g *Game) run() {
+	ticker := time.NewTicker(time.Duration(g.tickMs) * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-g.done:
+			return
+		case s := <-g.sregister:
+			g.mu.Lock()
+			g.spectators[s.Id] = s
+			g.mu.Unlock()
+		case s := <-g.sunregister:
+			g.mu.Lock()
+			delete(g.spectators, s.Id)
+			g.mu.Unlock()
+		case <-ticker.C:
+			// A tick that decided the match has already closed done.
+			select {
+			case <-g.done:
+				return
+			default:
+			}
+			start := time.Now()
+			g.updateWorld()
+			g.tickTimes.add(int64(time.Since(start)))
+		}
+	}
+}
+
+// stop terminates the tick loop. It must only be called once per game.
+func (g *Game) stop() {
+	close(g.done)
+}
+
+type gameSummary struct {
+	Id          string `json:"id"`
+	Mode        string `json:"mode"`
+	PlayerCount int    `json:"player_count"`
+}
+
+func (g *Game) summary() gameSummary {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return gameSummary{Id: g.Id, Mode: g.mode.Name(), PlayerCount: len(g.players)}
+}
+
+// tagChangeWindow is how far back tagChangesPerSec looks when turning
+// raw tag-change events into a rate.
+const tagChangeWindow = 10 * time.Second
+
+// gameStats reports how a game's tick loop and match are performing.
+type gameStats struct {
+	Id               string  `json:"id"`
+	PlayerCount      int     `json:"player_count"`
+	AvgTickTimeMs    float64 `json:"avg_tick_time_ms"`
+	P95TickTimeMs    float64 `json:"p95_tick_time_ms"`
+	TagChangesPerSec float64 `json:"tag_changes_per_sec"`
+}
+
+func (g *Game) stats() gameStats {
+	g.mu.RLock()
+	playerCount := len(g.players)
+	g.mu.RUnlock()
+
+	samples := g.tickTimes.snapshot()
+	durations := make([]int64, len(samples))
+	for i, s := range samples {
+		durations[i] = s.Value
+	}
+	tagChanges := g.tagChanges.countWithin(tagChangeWindow)
+
+	return gameStats{
+		Id:               g.Id,
+		PlayerCount:      playerCount,
+		AvgTickTimeMs:    float64(averageOf(durations)) / float64(time.Millisecond),
+		P95TickTimeMs:    float64(percentileOf(durations, 0.95)) / float64(time.Millisecond),
+		TagChangesPerSec: float64(tagChanges) / tagChangeWindow.Seconds(),
+	}
+}
+
+// playerBandwidth is the recent tx/rx history for a single player's
+// connection.
+type playerBandwidth struct {
+	PlayerId int            `json:"player_id"`
+	Tx       []metricSample `json:"tx"`
+	Rx       []metricSample `json:"rx"`
+}
+
+func (g *Game) bandwidth() []playerBandwidth {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	out := make([]playerBandwidth, 0, len(g.players))
+	for _, p := range g.players {
+		out = append(out, playerBandwidth{
+			PlayerId: p.Id,
+			Tx:       p.Connection.tx.snapshot(),
+			Rx:       p.Connection.rx.snapshot(),
+		})
+	}
+	return out
+}
+
+// handleConnection upgrades r into a websocket and runs the player's
+// read loop until it disconnects.
+func (g *Game) handleConnection(w http.ResponseWriter, r *http.Request) {
+	rawConn, err := upgrader.Upgrade(w, r, nil)
+	log.Println("open")
+	if err != nil {
+		log.Print("upgrade:", err)
+		return
+	}
+	connection := newMeteredConn(rawConn)
+	defer connection.Close()
+
+	var handshake handshakeMessage
+	if err := connection.ReadJSON(&handshake); err != nil || handshake.Type != "player" {
+		log.Println("player handshake failed:", err)
+		return
+	}
+
+	currentPlayer := new(player)
+	currentPlayer.Connection = connection
+	currentPlayer.X = (rand.Float64() - 0.5) * g.width
+	currentPlayer.Y = (rand.Float64() - 0.5) * g.height
+	currentPlayer.LastTagTime = time.Now().Add(-3 * time.Second).UnixNano()
+	currentPlayer.Team = handshake.Team
+	currentPlayer.writeChannel = make(chan interface{}, 100)
+
+	g.mu.Lock()
+	currentPlayer.Id = g.nextId
+	g.nextId++
+	if len(g.players) == 0 {
+		currentPlayer.IsTag = true // The first connected player is the tag
+	}
+	g.players[currentPlayer.Id] = currentPlayer
+	g.mu.Unlock()
+
+	go currentPlayer.processWriteChannel()
+
+	// One-shot: tell the client what it's navigating around.
+	currentPlayer.send(MapMessage{Type: "map", Obstacles: g.obstacles})
+
+	// Initialize the new player on the client
+	currentPlayer.send(currentPlayer.toMessage(true))
+
+	// Notify all other players and spectators about the new player
+	go func() {
+		g.mu.RLock()
+		defer g.mu.RUnlock()
+		for _, otherPlayer := range g.players {
+			if otherPlayer.Id != currentPlayer.Id {
+				currentPlayer.send(otherPlayer.toMessage(false))
+				otherPlayer.send(currentPlayer.toMessage(false))
+			}
+		}
+		for _, s := range g.spectators {
+			s.send(currentPlayer.toMessage(true))
+		}
+	}()
+
+	for {
+		// The client only ever sends intent; position and velocity stay
+		// server-authoritative and are advanced in updateWorld.
+		_, raw, err := currentPlayer.Connection.ReadMessage()
+		if err != nil {
+			log.Println("Player Disconnected waiting", err)
+			g.removePlayer(currentPlayer)
+			return
+		}
+
+		if !currentPlayer.allowInput() {
+			continue // over the rate limit: drop the message, keep the connection
+		}
+
+		var input InputMessage
+		if err := json.Unmarshal(raw, &input); err != nil {
+			log.Println("malformed input from player", currentPlayer.Id, err)
+			continue // don't drop the connection over a bad packet
+		}
+
+		g.mu.Lock()
+		if !currentPlayer.Frozen {
+			currentPlayer.Turn = input.Turn
+			currentPlayer.Thrust = input.Thrust
+		}
+		currentPlayer.LastInputSeq = input.Seq
+		g.mu.Unlock()
+	}
+}
+
+// removePlayer drops a disconnected player from the game, reassigning
+// the tag if necessary, and notifies the remaining players.
+func (g *Game) removePlayer(p *player) {
+	g.mu.Lock()
+	var newTagPlayer *player
+	if _, ok := g.players[p.Id]; ok {
+		delete(g.players, p.Id)
+		if p.IsTag && len(g.players) > 0 {
+			i := rand.Intn(len(g.players))
+			j := 0
+			for _, other := range g.players {
+				if j == i {
+					newTagPlayer = other
+					break
+				}
+				j++
+			}
+			newTagPlayer.IsTag = true
+		}
+	}
+	players := make([]*player, 0, len(g.players))
+	for _, other := range g.players {
+		players = append(players, other)
+	}
+	spectators := make([]*spectator, 0, len(g.spectators))
+	for _, s := range g.spectators {
+		spectators = append(spectators, s)
+	}
+	g.mu.Unlock()
+
+	for _, other := range players {
+		if newTagPlayer != nil {
+			other.send(newTagPlayer.toMessage(false))
+		}
+		other.send(StateMessage{Id: p.Id, HasDisconnected: true})
+	}
+	for _, s := range spectators {
+		if newTagPlayer != nil {
+			s.send(newTagPlayer.toMessage(false))
+		}
+		s.send(StateMessage{Id: p.Id, HasDisconnected: true})
+	}
+}
+
+func (g *Game) updateWorld() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	// Perform movement calculations
+	for _, p := range g.players {
+		if p.Frozen {
+			// Frozen players stop dead until a teammate unfreezes them;
+			// skip integration entirely rather than just ignoring new
+			// input, or they'd coast on whatever velocity they had.
+			p.VelocityX, p.VelocityY = 0, 0
+			continue
+		}
+		p.Angle = p.Angle - float64(p.Turn)*turnSpeed
+		acceleration := 0.1
+		if !p.Thrust {
+			acceleration = 0
+		}
+		direction := vector.NewVector3(math.Cos(p.Angle), math.Sin(p.Angle), 0)
+		velocity := vector.NewVector3(p.VelocityX, p.VelocityY, 0).Add(direction.Scale(acceleration))
+		speed := velocity.Length()
+		if speed > maxSpeed {
+			velocity = velocity.Normalize().Scale(maxSpeed)
+		} else if !p.Thrust && speed > 0 {
+			velocity = velocity.Normalize().Scale(speed * 0.99)
+		}
+		p.VelocityX = velocity[0]
+		p.VelocityY = velocity[1]
+
+		p.X = p.X + velocity[0]
+		p.Y = p.Y + velocity[1]
+		xLimit, yLimit := g.width/2+60, g.height/2+160
+		if g.wrapEdges {
+			if p.X > xLimit {
+				p.X = -xLimit
+			} else if p.X < -xLimit {
+				p.X = xLimit
+			}
+			if p.Y > yLimit+120 {
+				p.Y = -yLimit
+			} else if p.Y < -yLimit {
+				p.Y = yLimit + 120
+			}
+		} else {
+			if p.X > xLimit {
+				p.X, p.VelocityX = xLimit, 0
+			} else if p.X < -xLimit {
+				p.X, p.VelocityX = -xLimit, 0
+			}
+			if p.Y > yLimit+120 {
+				p.Y, p.VelocityY = yLimit+120, 0
+			} else if p.Y < -yLimit {
+				p.Y, p.VelocityY = -yLimit, 0
+			}
+		}
+
+		for _, o := range g.obstacles {
+			if nx, ny, normalX, normalY, hit := o.Resolve(p.X, p.Y, radius); hit {
+				p.X, p.Y = nx, ny
+				into := p.VelocityX*normalX + p.VelocityY*normalY
+				p.VelocityX -= into * normalX
+				p.VelocityY -= into * normalY
+			}
+		}
+	}
+
+	// Check collisions
+	ps := make([]*player, 0, len(g.players))
+	for _, p := range g.players {
+		ps = append(ps, p)
+	}
+	var oldTagPlayer, newTagPlayer *player
+	for i := 0; i < len(ps)-1; i++ {
+		for j := i + 1; j < len(ps); j++ {
+			firstPlayer := ps[i]
+			secondPlayer := ps[j]
+			firstPosition := vector.NewVector3(firstPlayer.X, firstPlayer.Y, 0)
+			secondPosition := vector.NewVector3(secondPlayer.X, secondPlayer.Y, 0)
+			distance := firstPosition.Sub(secondPosition).Length()
+			if distance < radius {
+				if oldTag, newTag := g.mode.OnCollision(firstPlayer, secondPlayer); oldTag != nil {
+					oldTagPlayer, newTagPlayer = oldTag, newTag
+				}
+			}
+		}
+	}
+
+	spectators := make([]*spectator, 0, len(g.spectators))
+	for _, s := range g.spectators {
+		spectators = append(spectators, s)
+	}
+
+	// Notify other players and spectators about tag change
+	if oldTagPlayer != nil && newTagPlayer != nil {
+		g.tagChanges.add(1)
+		go func() {
+			for _, p := range ps {
+				p.send(oldTagPlayer.toMessage(false))
+				p.send(newTagPlayer.toMessage(false))
+			}
+			for _, s := range spectators {
+				s.send(oldTagPlayer.toMessage(false))
+				s.send(newTagPlayer.toMessage(false))
+			}
+		}()
+	}
+
+	// Ask the mode whether the match is decided. If so, announce the
+	// winner and unregister the game instead of broadcasting more state.
+	if winner, over := g.mode.CheckWin(g); over {
+		message := GameOverMessage{Type: "game_over", Winner: winner}
+		for _, p := range ps {
+			p.send(message)
+		}
+		for _, s := range spectators {
+			s.send(message)
+		}
+		// registry.remove only takes r.mu, never g.mu, so it's safe to call
+		// synchronously here; stopping the tick loop before we unlock
+		// keeps run() from picking ticker.C again and re-deciding a match
+		// that's already over.
+		registry.remove(g.Id)
+		return
+	}
+
+	// Broadcast the authoritative state computed this tick to everyone,
+	// each player's own message carrying the ack for its last input.
+	go func() {
+		for _, p := range ps {
+			state := p.toMessage(false)
+			for _, other := range ps {
+				other.send(state)
+			}
+			for _, s := range spectators {
+				s.send(state)
+			}
+		}
+	}()
+}
+
+// gameRegistry tracks every running Game, keyed by id, guarded by a
+// RWMutex so control-plane requests never race the per-game tick
+// goroutines.
+type gameRegistry struct {
+	mu     sync.RWMutex
+	games  map[string]*Game
+	nextId int
+}
+
+var registry = &gameRegistry{games: make(map[string]*Game)}
+
+func (r *gameRegistry) create(cfg gameConfig) *Game {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextId++
+	id := strconv.Itoa(r.nextId)
+	g := newGame(id, cfg)
+	r.games[id] = g
+	go g.run()
+	return g
+}
+
+func (r *gameRegistry) get(id string) (*Game, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	g, ok := r.games[id]
+	return g, ok
+}
+
+func (r *gameRegistry) list() []*Game {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	games := make([]*Game, 0, len(r.games))
+	for _, g := range r.games {
+		games = append(games, g)
+	}
+	return games
+}
+
+func (r *gameRegistry) remove(id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	g, ok := r.games[id]
+	if !ok {
+		return false
+	}
+	g.stop()
+	delete(r.games, id)
+	return true
+}
+
+// errorEnvelope is the JSON body returned by the game control endpoints
+// on failure, e.g. {"error":"game not found"}.
+type errorEnvelope struct {
+	Error string `json:"error"`
+}
+
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorEnvelope{Error: message})
+}
+
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(value)
+}
+
+// startGameRequest is the optional JSON body accepted by /game/start,
+// used to pick the match rules and seed the arena. Any field left out
+// falls back to its default: classic mode, defaultTickMs, mapWidth and
+// mapHeight, wrap-around edges, and no obstacles.
+type startGameRequest struct {
+	Mode      string  `json:"mode"`
+	TickMs    int     `json:"tick_ms"`
+	MaxPoints int     `json:"max_points"`
+	Width     float64 `json:"width"`
+	Height    float64 `json:"height"`
+	Map       string  `json:"map"`
+	WrapEdges *bool   `json:"wrap_edges"`
+}
+
+// startGameHandler creates a new game and returns its id.
+func startGameHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	var req startGameRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		writeJSONError(w, http.StatusBadRequest, "malformed request body")
+		return
+	}
+	mode, err := newGameMode(req.Mode, req.MaxPoints)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var obstacles []obstacle.Obstacle
+	if req.Map != "" {
+		obstacles, err = obstacle.LoadNamed(mapsDir, req.Map)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "loading map: "+err.Error())
+			return
+		}
+	}
+	wrapEdges := req.WrapEdges == nil || *req.WrapEdges
+	g := registry.create(gameConfig{
+		Mode:      mode,
+		TickMs:    req.TickMs,
+		Width:     req.Width,
+		Height:    req.Height,
+		WrapEdges: wrapEdges,
+		Obstacles: obstacles,
+	})
+	writeJSON(w, g.summary())
+}
+
+// listGamesHandler returns a summary of every running game.
+func listGamesHandler(w http.ResponseWriter, r *http.Request) {
+	games := registry.list()
+	summaries := make([]gameSummary, 0, len(games))
+	for _, g := range games {
+		summaries = append(summaries, g.summary())
+	}
+	writeJSON(w, summaries)
+}
+
+// gameStatsHandler returns tick-time and tag-change metrics for the
+// game named by the trailing path segment, e.g. /game/stats/3.
+func gameStatsHandler(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/game/stats/")
+	g, ok := registry.get(id)
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "game not found")
+		return
+	}
+	writeJSON(w, g.stats())
+}
+
+// gameBandwidthHandler returns the recent tx/rx byte history for every
+// player in the game named by the trailing path segment, e.g.
+// /game/bw/3.
+func gameBandwidthHandler(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/game/bw/")
+	g, ok := registry.get(id)
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "game not found")
+		return
+	}
+	writeJSON(w, g.bandwidth())
+}
+
+// stopGameHandler terminates a running game, given by the "id" query
+// parameter, and disconnects no further players.
+func stopGameHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if !registry.remove(id) {
+		writeJSONError(w, http.StatusNotFound, "game not found")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
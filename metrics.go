@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ringSize bounds how much history a ringBuffer retains before it
+// starts overwriting its oldest samples.
+const ringSize = 120
+
+// metricSample is one timestamped observation, e.g. bytes transferred
+// on a websocket or a tick's simulation duration.
+type metricSample struct {
+	Time  int64 `json:"t"`
+	Value int64 `json:"v"`
+}
+
+// ringBuffer is a fixed-size, mutex-guarded circular buffer of recent
+// metric samples.
+type ringBuffer struct {
+	mu      sync.Mutex
+	samples []metricSample
+	next    int
+	filled  bool
+}
+
+func newRingBuffer(size int) *ringBuffer {
+	return &ringBuffer{samples: make([]metricSample, size)}
+}
+
+func (rb *ringBuffer) add(value int64) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	rb.samples[rb.next] = metricSample{Time: time.Now().UnixNano(), Value: value}
+	rb.next = (rb.next + 1) % len(rb.samples)
+	if rb.next == 0 {
+		rb.filled = true
+	}
+}
+
+// snapshot returns the buffered samples in chronological order.
+func (rb *ringBuffer) snapshot() []metricSample {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	if !rb.filled {
+		out := make([]metricSample, rb.next)
+		copy(out, rb.samples[:rb.next])
+		return out
+	}
+	out := make([]metricSample, len(rb.samples))
+	copy(out, rb.samples[rb.next:])
+	copy(out[len(rb.samples)-rb.next:], rb.samples[:rb.next])
+	return out
+}
+
+// countWithin returns how many samples were recorded within the last
+// window, e.g. to turn raw tag-change events into a rate.
+func (rb *ringBuffer) countWithin(window time.Duration) int {
+	cutoff := time.Now().Add(-window).UnixNano()
+	count := 0
+	for _, s := range rb.snapshot() {
+		if s.Time >= cutoff {
+			count++
+		}
+	}
+	return count
+}
+
+func averageOf(values []int64) int64 {
+	if len(values) == 0 {
+		return 0
+	}
+	var sum int64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / int64(len(values))
+}
+
+func percentileOf(values []int64, p float64) int64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]int64(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	idx := int(p * float64(len(sorted)))
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx]
+}
+
+// meteredConn wraps a websocket connection to record the size of every
+// message read from and written to it into per-connection ring
+// buffers, without changing how callers use the connection.
+type meteredConn struct {
+	*websocket.Conn
+	tx *ringBuffer
+	rx *ringBuffer
+}
+
+func newMeteredConn(conn *websocket.Conn) *meteredConn {
+	return &meteredConn{Conn: conn, tx: newRingBuffer(ringSize), rx: newRingBuffer(ringSize)}
+}
+
+func (m *meteredConn) ReadMessage() (int, []byte, error) {
+	messageType, data, err := m.Conn.ReadMessage()
+	if err == nil {
+		m.rx.add(int64(len(data)))
+	}
+	return messageType, data, err
+}
+
+func (m *meteredConn) ReadJSON(v interface{}) error {
+	_, data, err := m.ReadMessage()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (m *meteredConn) WriteJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	m.tx.add(int64(len(data)))
+	return m.Conn.WriteMessage(websocket.TextMessage, data)
+}
@@ -0,0 +1,63 @@
+package main
+
+import "testing"
+
+func TestRingBufferSnapshotBeforeFull(t *testing.T) {
+	rb := newRingBuffer(5)
+	rb.add(1)
+	rb.add(2)
+	rb.add(3)
+
+	got := rb.snapshot()
+	if len(got) != 3 {
+		t.Fatalf("len(snapshot) = %d, want 3", len(got))
+	}
+	for i, want := range []int64{1, 2, 3} {
+		if got[i].Value != want {
+			t.Errorf("snapshot[%d] = %d, want %d", i, got[i].Value, want)
+		}
+	}
+}
+
+func TestRingBufferSnapshotWrapsAround(t *testing.T) {
+	rb := newRingBuffer(3)
+	for _, v := range []int64{1, 2, 3, 4, 5} {
+		rb.add(v)
+	}
+
+	got := rb.snapshot()
+	if len(got) != 3 {
+		t.Fatalf("len(snapshot) = %d, want 3", len(got))
+	}
+	// The buffer holds 3 samples; the oldest two (1, 2) were overwritten,
+	// leaving the most recent three in chronological order.
+	for i, want := range []int64{3, 4, 5} {
+		if got[i].Value != want {
+			t.Errorf("snapshot[%d] = %d, want %d", i, got[i].Value, want)
+		}
+	}
+}
+
+func TestAverageOf(t *testing.T) {
+	if got := averageOf(nil); got != 0 {
+		t.Errorf("averageOf(nil) = %d, want 0", got)
+	}
+	if got := averageOf([]int64{2, 4, 6}); got != 4 {
+		t.Errorf("averageOf({2,4,6}) = %d, want 4", got)
+	}
+}
+
+func TestPercentileOf(t *testing.T) {
+	if got := percentileOf(nil, 0.95); got != 0 {
+		t.Errorf("percentileOf(nil, 0.95) = %d, want 0", got)
+	}
+
+	values := []int64{10, 30, 20, 50, 40}
+	if got := percentileOf(values, 0); got != 10 {
+		t.Errorf("percentileOf(values, 0) = %d, want 10", got)
+	}
+	// p=1.0 must not index past the end of the sorted slice.
+	if got := percentileOf(values, 1); got != 50 {
+		t.Errorf("percentileOf(values, 1) = %d, want 50", got)
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// defaultMaxPoints is used by point-scoring modes when the start
+// request omits max_points or supplies a non-positive value.
+const defaultMaxPoints = 10
+
+// GameMode encapsulates the rules of a match: how a tag-range collision
+// between two players is resolved, and when the match is over.
+// OnCollision and CheckWin are only ever called from within
+// Game.updateWorld, which already holds g.mu for writing, and Name from
+// Game.summary, which holds it for reading, so implementations must not
+// lock it themselves.
+type GameMode interface {
+	Name() string
+
+	// OnCollision resolves a tag-range collision, mutating first and
+	// second in place. It returns the players whose IsTag changed, for
+	// the caller to broadcast, or (nil, nil) if tag state didn't change.
+	OnCollision(first, second *player) (oldTag, newTag *player)
+
+	// CheckWin inspects the current match state and reports a winner,
+	// if the mode's win condition has been met.
+	CheckWin(g *Game) (winner string, over bool)
+}
+
+// tagSwap is the classic tag rule shared by every mode that still has a
+// single roaming tag: the tagger passes IsTag to whoever it touches,
+// subject to the tag cooldown.
+func tagSwap(first, second *player) (oldTag, newTag *player) {
+	now := time.Now().UnixNano()
+	if first.IsTag && now-second.LastTagTime > cooldown {
+		first.IsTag = false
+		first.LastTagTime = now
+		second.IsTag = true
+		return first, second
+	}
+	if second.IsTag && now-first.LastTagTime > cooldown {
+		second.IsTag = false
+		second.LastTagTime = now
+		first.IsTag = true
+		return second, first
+	}
+	return nil, nil
+}
+
+// classicMode is the original rule set: one tag, passed on touch,
+// no win condition.
+type classicMode struct{}
+
+func (classicMode) Name() string { return "classic" }
+
+func (classicMode) OnCollision(first, second *player) (oldTag, newTag *player) {
+	return tagSwap(first, second)
+}
+
+func (classicMode) CheckWin(g *Game) (string, bool) { return "", false }
+
+// freezeMode: the tagger freezes whoever it touches instead of passing
+// the tag on. A frozen player is unfrozen by any other unfrozen,
+// non-tagger player touching them. The tagger wins once every other
+// player is frozen.
+type freezeMode struct{}
+
+func (freezeMode) Name() string { return "freeze" }
+
+func (freezeMode) OnCollision(first, second *player) (oldTag, newTag *player) {
+	switch {
+	case first.IsTag && !second.IsTag:
+		second.Frozen = true
+	case second.IsTag && !first.IsTag:
+		first.Frozen = true
+	case first.Frozen && !second.Frozen:
+		first.Frozen = false
+	case second.Frozen && !first.Frozen:
+		second.Frozen = false
+	}
+	return nil, nil
+}
+
+func (freezeMode) CheckWin(g *Game) (string, bool) {
+	var tagger *player
+	othersFrozen := true
+	for _, p := range g.players {
+		if p.IsTag {
+			tagger = p
+			continue
+		}
+		if !p.Frozen {
+			othersFrozen = false
+		}
+	}
+	if tagger == nil || len(g.players) < 2 || !othersFrozen {
+		return "", false
+	}
+	return strconv.Itoa(tagger.Id), true
+}
+
+// teamMode splits players into two tag teams. Tags only happen across
+// teams; each successful tag scores the tagging team a point, and the
+// first team to reach maxPoints wins.
+type teamMode struct {
+	maxPoints int
+}
+
+func (m *teamMode) Name() string { return "team" }
+
+func (m *teamMode) OnCollision(first, second *player) (oldTag, newTag *player) {
+	if first.Team == 0 || second.Team == 0 || first.Team == second.Team {
+		return nil, nil
+	}
+	oldTag, newTag = tagSwap(first, second)
+	if oldTag != nil {
+		oldTag.Score++
+	}
+	return oldTag, newTag
+}
+
+func (m *teamMode) CheckWin(g *Game) (string, bool) {
+	scores := map[int]int{}
+	for _, p := range g.players {
+		if p.Team != 0 {
+			scores[p.Team] += p.Score
+		}
+	}
+	for team, score := range scores {
+		if score >= m.maxPoints {
+			return fmt.Sprintf("team-%d", team), true
+		}
+	}
+	return "", false
+}
+
+// timedMode is classic tag where every successful tag scores the
+// tagger a point; the first player to reach maxPoints wins the round.
+type timedMode struct {
+	maxPoints int
+}
+
+func (m *timedMode) Name() string { return "timed" }
+
+func (m *timedMode) OnCollision(first, second *player) (oldTag, newTag *player) {
+	oldTag, newTag = tagSwap(first, second)
+	if oldTag != nil {
+		oldTag.Score++
+	}
+	return oldTag, newTag
+}
+
+func (m *timedMode) CheckWin(g *Game) (string, bool) {
+	for _, p := range g.players {
+		if p.Score >= m.maxPoints {
+			return strconv.Itoa(p.Id), true
+		}
+	}
+	return "", false
+}
+
+// newGameMode builds the GameMode named by the /game/start request, or
+// classic if none was given.
+func newGameMode(name string, maxPoints int) (GameMode, error) {
+	if maxPoints <= 0 {
+		maxPoints = defaultMaxPoints
+	}
+	switch name {
+	case "", "classic":
+		return classicMode{}, nil
+	case "freeze":
+		return freezeMode{}, nil
+	case "team":
+		return &teamMode{maxPoints: maxPoints}, nil
+	case "timed":
+		return &timedMode{maxPoints: maxPoints}, nil
+	default:
+		return nil, fmt.Errorf("unknown game mode %q", name)
+	}
+}
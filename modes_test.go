@@ -0,0 +1,113 @@
+package main
+
+import "testing"
+
+func TestClassicModeNeverWins(t *testing.T) {
+	g := &Game{players: map[int]*player{
+		1: {Id: 1, IsTag: true},
+		2: {Id: 2},
+	}}
+	if _, over := (classicMode{}).CheckWin(g); over {
+		t.Fatal("classic mode should never declare a winner")
+	}
+}
+
+func TestFreezeModeCheckWin(t *testing.T) {
+	cases := []struct {
+		name       string
+		players    map[int]*player
+		wantWinner string
+		wantOver   bool
+	}{
+		{
+			name: "tagger wins once everyone else is frozen",
+			players: map[int]*player{
+				1: {Id: 1, IsTag: true},
+				2: {Id: 2, Frozen: true},
+				3: {Id: 3, Frozen: true},
+			},
+			wantWinner: "1",
+			wantOver:   true,
+		},
+		{
+			name: "one player still unfrozen",
+			players: map[int]*player{
+				1: {Id: 1, IsTag: true},
+				2: {Id: 2, Frozen: true},
+				3: {Id: 3, Frozen: false},
+			},
+			wantOver: false,
+		},
+		{
+			name: "no tagger in the game",
+			players: map[int]*player{
+				1: {Id: 1, Frozen: true},
+				2: {Id: 2, Frozen: true},
+			},
+			wantOver: false,
+		},
+		{
+			name: "single player can't win alone",
+			players: map[int]*player{
+				1: {Id: 1, IsTag: true},
+			},
+			wantOver: false,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			g := &Game{players: c.players}
+			winner, over := (freezeMode{}).CheckWin(g)
+			if over != c.wantOver {
+				t.Fatalf("over = %v, want %v", over, c.wantOver)
+			}
+			if over && winner != c.wantWinner {
+				t.Errorf("winner = %q, want %q", winner, c.wantWinner)
+			}
+		})
+	}
+}
+
+func TestTeamModeCheckWin(t *testing.T) {
+	mode := &teamMode{maxPoints: 10}
+
+	g := &Game{players: map[int]*player{
+		1: {Id: 1, Team: 1, Score: 4},
+		2: {Id: 2, Team: 1, Score: 6},
+		3: {Id: 3, Team: 2, Score: 3},
+	}}
+	winner, over := mode.CheckWin(g)
+	if !over || winner != "team-1" {
+		t.Fatalf("CheckWin = (%q, %v), want (\"team-1\", true)", winner, over)
+	}
+
+	g = &Game{players: map[int]*player{
+		1: {Id: 1, Team: 1, Score: 4},
+		2: {Id: 2, Team: 2, Score: 3},
+	}}
+	if _, over := mode.CheckWin(g); over {
+		t.Fatal("no team has reached maxPoints yet")
+	}
+}
+
+func TestTimedModeCheckWin(t *testing.T) {
+	mode := &timedMode{maxPoints: 5}
+
+	g := &Game{players: map[int]*player{
+		1: {Id: 1, Score: 2},
+		2: {Id: 2, Score: 5},
+	}}
+	winner, over := mode.CheckWin(g)
+	if !over || winner != "2" {
+		t.Fatalf("CheckWin = (%q, %v), want (\"2\", true)", winner, over)
+	}
+
+	g = &Game{players: map[int]*player{
+		1: {Id: 1, Score: 2},
+		2: {Id: 2, Score: 4},
+	}}
+	if _, over := mode.CheckWin(g); over {
+		t.Fatal("no player has reached maxPoints yet")
+	}
+}
@@ -0,0 +1,126 @@
+// Package obstacle describes the static geometry of a game's arena —
+// rectangles and circles loaded from a JSON map file — and how a moving
+// circle (a player) collides with it.
+package obstacle
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Shape selects which fields of an Obstacle its collision geometry
+// uses.
+type Shape string
+
+const (
+	Rectangle Shape = "rectangle"
+	Circle    Shape = "circle"
+)
+
+// Obstacle is one static piece of map geometry, centered on X/Y. A
+// Rectangle uses Width and Height; a Circle uses Radius and ignores
+// Width/Height.
+type Obstacle struct {
+	Shape  Shape   `json:"shape"`
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width,omitempty"`
+	Height float64 `json:"height,omitempty"`
+	Radius float64 `json:"radius,omitempty"`
+}
+
+// Load reads a JSON map file — a top-level array of Obstacle objects —
+// from path.
+func Load(path string) ([]Obstacle, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var obstacles []Obstacle
+	if err := json.Unmarshal(data, &obstacles); err != nil {
+		return nil, fmt.Errorf("parse map %s: %w", path, err)
+	}
+	return obstacles, nil
+}
+
+// LoadNamed loads the map named name from dir. name is cleaned as if it
+// were rooted at dir, so an absolute path or leading ".." elements cannot
+// climb out: "/x.json" and "../x.json" both resolve to dir/x.json. Use
+// this instead of Load whenever name comes from an untrusted client,
+// such as an HTTP request body.
+func LoadNamed(dir, name string) ([]Obstacle, error) {
+	path := filepath.Join(dir, filepath.Clean(string(filepath.Separator)+name))
+	if rel, err := filepath.Rel(dir, path); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, fmt.Errorf("map name %q is not a valid map", name)
+	}
+	return Load(path)
+}
+
+// Resolve checks a circle of the given radius centered on (x, y)
+// against o. If it penetrates, Resolve returns the position clamped
+// back to the surface and the outward surface normal at that point, so
+// the caller can zero out the velocity driving it into the surface. ok
+// is false if the circle doesn't touch o.
+func (o Obstacle) Resolve(x, y, radius float64) (nx, ny, normalX, normalY float64, ok bool) {
+	if o.Shape == Circle {
+		return o.resolveCircle(x, y, radius)
+	}
+	return o.resolveRectangle(x, y, radius)
+}
+
+func (o Obstacle) resolveRectangle(x, y, radius float64) (nx, ny, normalX, normalY float64, ok bool) {
+	left, right := o.X-o.Width/2, o.X+o.Width/2
+	top, bottom := o.Y-o.Height/2, o.Y+o.Height/2
+
+	closestX := math.Min(math.Max(x, left), right)
+	closestY := math.Min(math.Max(y, top), bottom)
+	dx, dy := x-closestX, y-closestY
+	dist := math.Hypot(dx, dy)
+
+	if dist == 0 {
+		// The center is inside the rectangle: push out along whichever
+		// edge is closest.
+		penetration := []struct {
+			amount               float64
+			nx, ny, normX, normY float64
+		}{
+			{x - left, left - radius, y, -1, 0},
+			{right - x, right + radius, y, 1, 0},
+			{y - top, x, top - radius, 0, -1},
+			{bottom - y, x, bottom + radius, 0, 1},
+		}
+		best := penetration[0]
+		for _, p := range penetration[1:] {
+			if p.amount < best.amount {
+				best = p
+			}
+		}
+		return best.nx, best.ny, best.normX, best.normY, true
+	}
+
+	if dist >= radius {
+		return x, y, 0, 0, false
+	}
+	normalX, normalY = dx/dist, dy/dist
+	return closestX + normalX*radius, closestY + normalY*radius, normalX, normalY, true
+}
+
+func (o Obstacle) resolveCircle(x, y, radius float64) (nx, ny, normalX, normalY float64, ok bool) {
+	dx, dy := x-o.X, y-o.Y
+	dist := math.Hypot(dx, dy)
+	minDist := radius + o.Radius
+
+	if dist >= minDist {
+		return x, y, 0, 0, false
+	}
+	if dist == 0 {
+		// Centers coincide: push out along an arbitrary axis.
+		return x + minDist, y, 1, 0, true
+	}
+	normalX, normalY = dx/dist, dy/dist
+	return o.X + normalX*minDist, o.Y + normalY*minDist, normalX, normalY, true
+}
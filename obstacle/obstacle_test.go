@@ -0,0 +1,144 @@
+package obstacle
+
+import (
+	"math"
+	"os"
+	"testing"
+)
+
+func approxEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestResolveRectangle(t *testing.T) {
+	rect := Obstacle{Shape: Rectangle, X: 0, Y: 0, Width: 100, Height: 50}
+
+	cases := []struct {
+		name                 string
+		x, y, radius         float64
+		wantHit              bool
+		wantNX, wantNY       float64
+		wantNormX, wantNormY float64
+	}{
+		{
+			name: "corner push-out",
+			x:    60, y: 40, radius: 20,
+			wantHit: true,
+			// Closest point on the rectangle is its corner (50, 25); the
+			// player is pushed out along the line from that corner.
+			wantNX:    50 + 20*10/math.Hypot(10, 15),
+			wantNY:    25 + 20*15/math.Hypot(10, 15),
+			wantNormX: 10 / math.Hypot(10, 15),
+			wantNormY: 15 / math.Hypot(10, 15),
+		},
+		{
+			name: "far away, no collision",
+			x:    500, y: 500, radius: 20,
+			wantHit: false,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			nx, ny, normalX, normalY, hit := rect.Resolve(c.x, c.y, c.radius)
+			if hit != c.wantHit {
+				t.Fatalf("hit = %v, want %v", hit, c.wantHit)
+			}
+			if !hit {
+				return
+			}
+			if !approxEqual(nx, c.wantNX) || !approxEqual(ny, c.wantNY) {
+				t.Errorf("position = (%v, %v), want (%v, %v)", nx, ny, c.wantNX, c.wantNY)
+			}
+			if !approxEqual(normalX, c.wantNormX) || !approxEqual(normalY, c.wantNormY) {
+				t.Errorf("normal = (%v, %v), want (%v, %v)", normalX, normalY, c.wantNormX, c.wantNormY)
+			}
+		})
+	}
+}
+
+func TestLoadNamedRejectsEscapingPaths(t *testing.T) {
+	root := t.TempDir()
+	dir := root + "/maps"
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dir+"/arena.json", []byte("[]"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Sits just outside dir; no name should be able to reach it.
+	if err := os.WriteFile(root+"/secret.json", []byte(`["leaked"]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadNamed(dir, "arena.json"); err != nil {
+		t.Fatalf("LoadNamed(valid name) = %v, want no error", err)
+	}
+
+	for _, name := range []string{"../secret.json", "../../secret.json", "/../secret.json"} {
+		if _, err := LoadNamed(dir, name); err == nil {
+			t.Errorf("LoadNamed(%q) resolved a file outside dir, want it rejected", name)
+		}
+	}
+}
+
+func TestResolveRectangleCenterInside(t *testing.T) {
+	rect := Obstacle{Shape: Rectangle, X: 0, Y: 0, Width: 100, Height: 50}
+
+	// (40, 5) is inside the rectangle and closest to its right edge (x=50).
+	nx, ny, normalX, normalY, hit := rect.Resolve(40, 5, 10)
+	if !hit {
+		t.Fatal("expected a collision for a point inside the rectangle")
+	}
+	if normalX != 1 || normalY != 0 {
+		t.Errorf("normal = (%v, %v), want (1, 0)", normalX, normalY)
+	}
+	if !approxEqual(nx, 60) || !approxEqual(ny, 5) {
+		t.Errorf("position = (%v, %v), want (60, 5)", nx, ny)
+	}
+}
+
+func TestResolveCircle(t *testing.T) {
+	circle := Obstacle{Shape: Circle, X: 0, Y: 0, Radius: 30}
+
+	cases := []struct {
+		name                 string
+		x, y, radius         float64
+		wantHit              bool
+		wantNX, wantNY       float64
+		wantNormX, wantNormY float64
+	}{
+		{
+			name: "circle-circle overlap along x axis",
+			x:    40, y: 0, radius: 20,
+			wantHit:   true,
+			wantNX:    50,
+			wantNY:    0,
+			wantNormX: 1,
+			wantNormY: 0,
+		},
+		{
+			name: "far away, no collision",
+			x:    100, y: 0, radius: 20,
+			wantHit: false,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			nx, ny, normalX, normalY, hit := circle.Resolve(c.x, c.y, c.radius)
+			if hit != c.wantHit {
+				t.Fatalf("hit = %v, want %v", hit, c.wantHit)
+			}
+			if !hit {
+				return
+			}
+			if !approxEqual(nx, c.wantNX) || !approxEqual(ny, c.wantNY) {
+				t.Errorf("position = (%v, %v), want (%v, %v)", nx, ny, c.wantNX, c.wantNY)
+			}
+			if !approxEqual(normalX, c.wantNormX) || !approxEqual(normalY, c.wantNormY) {
+				t.Errorf("normal = (%v, %v), want (%v, %v)", normalX, normalY, c.wantNormX, c.wantNormY)
+			}
+		})
+	}
+}
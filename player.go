@@ -0,0 +1,123 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/Lerg/multiplayer-tag-server/obstacle"
+)
+
+// maxInputsPerSecond caps how many input messages a single connection
+// may submit before further messages are silently dropped for the rest
+// of the window.
+const maxInputsPerSecond = 120
+
+// InputMessage is the only message a connected player may send: it
+// carries intent, never state. The server is authoritative over
+// position and velocity.
+type InputMessage struct {
+	Turn   int8   `json:"turn"`
+	Thrust bool   `json:"thrust"`
+	Seq    uint32 `json:"seq"`
+}
+
+// StateMessage is the server's authoritative view of a player, sent to
+// players and spectators alike. AckSeq echoes the Seq of the most
+// recent input the server applied for this player, so its own client
+// can reconcile predicted state.
+type StateMessage struct {
+	Id              int     `json:"id"`
+	X               float64 `json:"x"`
+	Y               float64 `json:"y"`
+	Angle           float64 `json:"angle"`
+	VelocityX       float64 `json:"velocity_x"`
+	VelocityY       float64 `json:"velocity_y"`
+	Turn            int8    `json:"turn"`
+	Thrust          bool    `json:"thrust"`
+	IsTag           bool    `json:"is_tag"`
+	IsNew           bool    `json:"is_new"`
+	HasDisconnected bool    `json:"has_disconnected"`
+	AckSeq          uint32  `json:"ack_seq"`
+	Team            int     `json:"team"`
+	Score           int     `json:"score"`
+	Frozen          bool    `json:"frozen"`
+}
+
+// GameOverMessage is broadcast once a GameMode declares a winner.
+type GameOverMessage struct {
+	Type   string `json:"type"`
+	Winner string `json:"winner"`
+}
+
+// MapMessage is sent once to each client immediately after it connects,
+// describing the obstacles it must navigate around.
+type MapMessage struct {
+	Type      string              `json:"type"`
+	Obstacles []obstacle.Obstacle `json:"obstacles"`
+}
+
+// Internal player data
+type player struct {
+	Connection   *meteredConn // Websocket connection of the player, wrapped to track bandwidth
+	Id           int          // Player id
+	X            float64      // Position vector
+	Y            float64
+	Angle        float64 // Direction angle
+	VelocityX    float64 // Velocity vector
+	VelocityY    float64
+	Turn         int8   // Current turnining value
+	Thrust       bool   // Current thruster state
+	IsTag        bool   // Is this player the tag
+	LastTagTime  int64  // When the last time the player was a tag
+	LastInputSeq uint32 // Seq of the last input applied by the server
+	Team         int    // Team number, 0 if the mode has no teams
+	Score        int    // Points accumulated under the current GameMode
+	Frozen       bool   // Frozen players ignore input until unfrozen
+	writeChannel chan interface{}
+
+	inputWindowStart int64 // Start of the current rate-limit window
+	inputCount       int   // Inputs received within the current window
+}
+
+func (p *player) toMessage(isNew bool) StateMessage {
+	return StateMessage{
+		Id: p.Id,
+		X:  p.X, Y: p.Y,
+		Angle:     p.Angle,
+		VelocityX: p.VelocityX, VelocityY: p.VelocityY,
+		Turn:   p.Turn,
+		Thrust: p.Thrust,
+		IsTag:  p.IsTag,
+		IsNew:  isNew,
+		AckSeq: p.LastInputSeq,
+		Team:   p.Team,
+		Score:  p.Score,
+		Frozen: p.Frozen}
+}
+
+func (p *player) send(message interface{}) {
+	p.writeChannel <- message
+}
+
+func (p *player) processWriteChannel() {
+	for {
+		message := <-p.writeChannel
+		if err := p.Connection.WriteJSON(message); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// allowInput enforces the per-connection input rate limit, dropping
+// messages once a client exceeds maxInputsPerSecond within a fixed
+// one-second window, which restarts with the first message after it
+// has run out.
+func (p *player) allowInput() bool {
+	now := time.Now().UnixNano()
+	if now-p.inputWindowStart > int64(time.Second) {
+		p.inputWindowStart = now
+		p.inputCount = 0
+	}
+	p.inputCount++
+	return p.inputCount <= maxInputsPerSecond
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strings"
+)
+
+// handshakeMessage is the first message a websocket client must send
+// after connecting, declaring whether it is joining as a "player" or a
+// read-only "spectator". Team is only consulted by team-based modes.
+type handshakeMessage struct {
+	Type string `json:"type"`
+	Team int    `json:"team"`
+}
+
+// spectator is a read-only observer of a game: it receives every
+// broadcast a player receives but never contributes input or state.
+type spectator struct {
+	Connection   *meteredConn
+	Id           int
+	writeChannel chan interface{}
+}
+
+func (s *spectator) send(message interface{}) {
+	s.writeChannel <- message
+}
+
+func (s *spectator) processWriteChannel() {
+	for {
+		message := <-s.writeChannel
+		if err := s.Connection.WriteJSON(message); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// spectateHandler routes a joining websocket connection to the game
+// named by the trailing path segment, e.g. /spectate/3.
+func spectateHandler(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/spectate/")
+	g, ok := registry.get(id)
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "game not found")
+		return
+	}
+	g.handleSpectator(w, r)
+}
+
+// handleSpectator upgrades r into a websocket, registers a read-only
+// spectator client and streams broadcasts to it until it disconnects.
+func (g *Game) handleSpectator(w http.ResponseWriter, r *http.Request) {
+	rawConn, err := upgrader.Upgrade(w, r, nil)
+	log.Println("spectator open")
+	if err != nil {
+		log.Print("upgrade:", err)
+		return
+	}
+	connection := newMeteredConn(rawConn)
+	defer connection.Close()
+
+	var handshake handshakeMessage
+	if err := connection.ReadJSON(&handshake); err != nil || handshake.Type != "spectator" {
+		log.Println("spectator handshake failed:", err)
+		return
+	}
+
+	s := &spectator{Connection: connection, writeChannel: make(chan interface{}, 100)}
+
+	g.mu.Lock()
+	s.Id = g.nextSpectatorId
+	g.nextSpectatorId++
+	g.mu.Unlock()
+
+	go s.processWriteChannel()
+
+	// One-shot: tell the client what it's navigating around.
+	s.send(MapMessage{Type: "map", Obstacles: g.obstacles})
+
+	// Bring the spectator up to date with the players already in the match.
+	g.mu.RLock()
+	for _, p := range g.players {
+		s.send(p.toMessage(false))
+	}
+	g.mu.RUnlock()
+
+	g.sregister <- s
+
+	// Spectators contribute nothing: just drain the socket so a closed
+	// connection is detected and unregistered.
+	for {
+		if _, _, err := connection.ReadMessage(); err != nil {
+			g.sunregister <- s
+			return
+		}
+	}
+}